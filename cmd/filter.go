@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/exascience/elprep/internal"
+	"github.com/exascience/elprep/sam"
+)
+
+const FilterHelp = "Filter parameters:\n" +
+	"elprep filter sam-file output-file\n" +
+	"[--filter-mapping-quality mapq]\n" +
+	"[--filter-base-quality phred]\n" +
+	"[--filter-mapping-quality-in-regions bed-file]\n" +
+	"[--output-type [sam | bam | cram]]\n" +
+	"[--reference-t fai-file]\n" +
+	"[--reference-T fasta-file]\n"
+
+/*
+Filter implements the elprep filter command.
+*/
+func Filter() error {
+	var (
+		outputType, reference_t, reference_T, filterMappingQualityInRegions string
+		filterMappingQuality                                                int
+		filterBaseQuality                                                   float64
+	)
+
+	var flags flag.FlagSet
+
+	flags.StringVar(&outputType, "output-type", "", "format of the output file")
+	flags.StringVar(&reference_t, "reference-t", "", "specify a .fai file for cram output")
+	flags.StringVar(&reference_T, "reference-T", "", "specify a .fasta file for cram output")
+	flags.IntVar(&filterMappingQuality, "filter-mapping-quality", -1, "remove reads with a MAPQ below this value")
+	flags.Float64Var(&filterBaseQuality, "filter-base-quality", -1, "remove reads with a mean base quality (Phred) below this value")
+	flags.StringVar(&filterMappingQualityInRegions, "filter-mapping-quality-in-regions", "", "only apply --filter-mapping-quality inside the intervals in this BED file")
+
+	if len(os.Args) < 4 {
+		fmt.Fprintln(os.Stderr, "Incorrect number of parameters.")
+		fmt.Fprint(os.Stderr, FilterHelp)
+		os.Exit(1)
+	}
+
+	input := getFilename(os.Args[2], FilterHelp)
+	output := getFilename(os.Args[3], FilterHelp)
+
+	if err := flags.Parse(os.Args[4:]); err != nil {
+		x := 0
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, err.Error())
+			x = 1
+		}
+		fmt.Fprint(os.Stderr, FilterHelp)
+		os.Exit(x)
+	}
+
+	ext := filepath.Ext(output)
+	if outputType == "" {
+		switch ext {
+		case ".sam", ".bam", ".cram":
+			outputType = ext[1:]
+		default:
+			outputType = "sam"
+		}
+	}
+
+	setLogOutput()
+
+	// sanity checks
+
+	sanityChecksFailed := false
+
+	reference_t, reference_T, success := checkCramOutputOptions(outputType, reference_t, reference_T)
+	sanityChecksFailed = !success
+
+	if filterMappingQualityInRegions != "" && filterMappingQuality < 0 {
+		sanityChecksFailed = true
+		log.Println("Error: --filter-mapping-quality-in-regions requires --filter-mapping-quality.")
+	}
+
+	if sanityChecksFailed {
+		fmt.Fprint(os.Stderr, FilterHelp)
+		os.Exit(1)
+	}
+
+	// building output command line
+
+	var command bytes.Buffer
+	fmt.Fprint(&command, os.Args[0], " filter ", input, " ", output)
+	fmt.Fprint(&command, " --output-type ", outputType)
+	if filterMappingQuality >= 0 {
+		fmt.Fprint(&command, " --filter-mapping-quality ", filterMappingQuality)
+	}
+	if filterBaseQuality >= 0 {
+		fmt.Fprint(&command, " --filter-base-quality ", filterBaseQuality)
+	}
+	if filterMappingQualityInRegions != "" {
+		fmt.Fprint(&command, " --filter-mapping-quality-in-regions ", filterMappingQualityInRegions)
+	}
+	if reference_t != "" {
+		fmt.Fprint(&command, " --reference-t ", reference_t)
+	}
+	if reference_T != "" {
+		fmt.Fprint(&command, " --reference-T ", reference_T)
+	}
+
+	// building the filter chain
+
+	var filters []sam.Filter
+
+	if filterMappingQualityInRegions != "" {
+		fullRegions, err := internal.FullPathname(filterMappingQualityInRegions)
+		if err != nil {
+			return err
+		}
+		regions, _, err := sam.ParseBEDFile(fullRegions)
+		if err != nil {
+			return err
+		}
+		filters = append(filters, sam.FilterByMAPQInRegions(filterMappingQuality, regions))
+	} else if filterMappingQuality >= 0 {
+		filters = append(filters, sam.FilterByMAPQ(filterMappingQuality))
+	}
+
+	if filterBaseQuality >= 0 {
+		filters = append(filters, sam.FilterByMeanBaseQuality(filterBaseQuality))
+	}
+
+	// executing command
+
+	log.Println("Executing command:\n", command.String())
+
+	fullInput, err := internal.FullPathname(input)
+	if err != nil {
+		return err
+	}
+
+	fullOutput, err := internal.FullPathname(output)
+	if err != nil {
+		return err
+	}
+
+	return sam.FilterFile(fullInput, fullOutput, outputType, reference_t, reference_T, filters)
+}
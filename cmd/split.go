@@ -19,15 +19,16 @@ const SplitHelp = "Split parameters:\n" +
 	"[--output-type [sam | bam | cram]]\n" +
 	"[--nr-of-threads nr]\n" +
 	"[--reference-t fai-file]\n" +
-	"[--reference-T fasta-file]\n"
+	"[--reference-T fasta-file]\n" +
+	"[--regions bed-file]\n"
 
 /*
 Split implements the elprep split command.
 */
 func Split() error {
 	var (
-		outputPrefix, outputType, reference_t, reference_T string
-		nrOfThreads                                        int
+		outputPrefix, outputType, reference_t, reference_T, regions string
+		nrOfThreads                                                 int
 	)
 
 	var flags flag.FlagSet
@@ -37,6 +38,7 @@ func Split() error {
 	flags.IntVar(&nrOfThreads, "nr-of-threads", 0, "number of worker threads")
 	flags.StringVar(&reference_t, "reference-t", "", "specify a .fai file for cram output")
 	flags.StringVar(&reference_T, "reference-T", "", "specify a .fasta file for cram output")
+	flags.StringVar(&regions, "regions", "", "split by the intervals in this BED file, instead of per chromosome")
 
 	if len(os.Args) < 4 {
 		fmt.Fprintln(os.Stderr, "Incorrect number of parameters.")
@@ -111,6 +113,9 @@ func Split() error {
 	if reference_T != "" {
 		fmt.Fprint(&command, " --reference-T ", reference_T)
 	}
+	if regions != "" {
+		fmt.Fprint(&command, " --regions ", regions)
+	}
 
 	// executing command
 
@@ -131,5 +136,13 @@ func Split() error {
 		return err
 	}
 
+	if regions != "" {
+		fullRegions, err := internal.FullPathname(regions)
+		if err != nil {
+			return err
+		}
+		return sam.SplitFilePerRegion(fullInput, fullOutput, outputPrefix, outputType, reference_t, reference_T, fullRegions)
+	}
+
 	return sam.SplitFilePerChromosome(fullInput, fullOutput, outputPrefix, outputType, reference_t, reference_T)
 }
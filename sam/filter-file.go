@@ -0,0 +1,75 @@
+package sam
+
+import "io"
+
+/*
+FilterFile applies filters, in order, to a single SAM/BAM/CRAM input
+file and writes the surviving alignments to a single output file. Each
+filter is first applied to the Header to obtain its per-alignment
+AlignmentFilter, exactly as a Filter chain is applied elsewhere in this
+package; an alignment is kept only if every resulting AlignmentFilter
+returns true for it.
+*/
+func FilterFile(input, output, outputType, reference_t, reference_T string, filters []Filter) (err error) {
+	in, err := Open(input, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		nerr := in.Close()
+		if err == nil {
+			err = nerr
+		}
+	}()
+
+	header, _, err := ParseHeader(in.Reader)
+	if err != nil {
+		return err
+	}
+
+	alnFilters := make([]AlignmentFilter, 0, len(filters))
+	for _, filter := range filters {
+		if alnFilter := filter(header); alnFilter != nil {
+			alnFilters = append(alnFilters, alnFilter)
+		}
+	}
+
+	out, err := Create(output, outputType, reference_t, reference_T)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		nerr := out.Close()
+		if err == nil {
+			err = nerr
+		}
+	}()
+
+	if err := out.WriteHeader(header); err != nil {
+		return err
+	}
+
+	for {
+		aln, aerr := ParseAlignment(in.Reader, header)
+		if aerr == io.EOF {
+			break
+		}
+		if aerr != nil {
+			return aerr
+		}
+		keep := true
+		for _, alnFilter := range alnFilters {
+			if !alnFilter(aln) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			if werr := out.WriteAlignment(aln); werr != nil {
+				return werr
+			}
+		}
+	}
+
+	return nil
+}
@@ -130,6 +130,60 @@ func FilterDuplicateReads(_ *Header) AlignmentFilter {
 	return func(aln *Alignment) bool { return (aln.FLAG & Duplicate) == 0 }
 }
 
+/*
+A filter for removing sam-alignment instances whose mapping quality
+(MAPQ) is below minMAPQ.
+*/
+func FilterByMAPQ(minMAPQ int) Filter {
+	return func(_ *Header) AlignmentFilter {
+		return func(aln *Alignment) bool { return int(aln.MAPQ) >= minMAPQ }
+	}
+}
+
+/*
+A filter for removing sam-alignment instances whose mean base quality
+(QUAL, Phred scaled) is below minPhred. Alignments with QUAL "*" (base
+qualities not stored) are kept.
+*/
+func FilterByMeanBaseQuality(minPhred float64) Filter {
+	return func(_ *Header) AlignmentFilter {
+		return func(aln *Alignment) bool {
+			if aln.QUAL == "*" {
+				return true
+			}
+			sum := 0
+			for i := 0; i < len(aln.QUAL); i++ {
+				sum += int(aln.QUAL[i]) - 33
+			}
+			return float64(sum)/float64(len(aln.QUAL)) >= minPhred
+		}
+	}
+}
+
+/*
+A filter for removing sam-alignment instances whose mapping quality
+(MAPQ) is below minMAPQ, but only when the alignment's RNAME/POS falls
+inside one of the given regions; alignments outside of all regions
+pass through unfiltered. regions is typically produced by
+ParseBEDFile; unlike SplitFilePerRegion, this filter only needs region
+membership, not distinct shard identity, so regions do not need to be
+disjoint: each chromosome's intervals are coalesced once up front.
+*/
+func FilterByMAPQInRegions(minMAPQ int, regions map[string][]Interval) Filter {
+	coalesced := make(map[string][]Interval, len(regions))
+	for chrom, intervals := range regions {
+		coalesced[chrom] = CoalesceIntervals(intervals)
+	}
+	return func(_ *Header) AlignmentFilter {
+		return func(aln *Alignment) bool {
+			if FindRegion(coalesced[aln.RNAME], int32(aln.POS)) < 0 {
+				return true
+			}
+			return int(aln.MAPQ) >= minMAPQ
+		}
+	}
+}
+
 var sr = utils.Intern("sr")
 
 /*
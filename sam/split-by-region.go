@@ -0,0 +1,279 @@
+package sam
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/exascience/elprep/utils"
+)
+
+/*
+An Interval represents a half-open genomic interval [Start, End), using
+BED's 0-based coordinates, on a single reference sequence.
+*/
+type Interval struct {
+	Start, End int32
+}
+
+/*
+ParseBEDFile reads a BED3/BED4 file and returns, for each reference
+sequence name, the intervals on that sequence sorted by Start, together
+with the region string for each interval (the BED name column if
+present, otherwise "chrom:start-end"). The intervals are sorted so that
+FindRegion can look them up with a binary search; ParseBEDFile itself
+does not reject overlapping entries, since not every caller needs them
+disjoint (see ValidateNonOverlapping and CoalesceIntervals).
+*/
+func ParseBEDFile(bedFile string) (regions map[string][]Interval, names map[string][]string, err error) {
+	file, err := os.Open(bedFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		nerr := file.Close()
+		if err == nil {
+			err = nerr
+		}
+	}()
+	regions = make(map[string][]Interval)
+	names = make(map[string][]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "track") || strings.HasPrefix(line, "browser") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			return nil, nil, fmt.Errorf("sam.ParseBEDFile: invalid BED line: %v", line)
+		}
+		start, serr := strconv.Atoi(fields[1])
+		if serr != nil {
+			return nil, nil, fmt.Errorf("sam.ParseBEDFile: invalid start coordinate in: %v", line)
+		}
+		end, eerr := strconv.Atoi(fields[2])
+		if eerr != nil {
+			return nil, nil, fmt.Errorf("sam.ParseBEDFile: invalid end coordinate in: %v", line)
+		}
+		chrom := fields[0]
+		name := fmt.Sprintf("%v:%v-%v", chrom, start, end)
+		if len(fields) >= 4 && fields[3] != "" {
+			name = fields[3]
+		}
+		regions[chrom] = append(regions[chrom], Interval{Start: int32(start), End: int32(end)})
+		names[chrom] = append(names[chrom], name)
+	}
+	if serr := scanner.Err(); serr != nil {
+		return nil, nil, serr
+	}
+	for chrom, intervals := range regions {
+		chromNames := names[chrom]
+		order := make([]int, len(intervals))
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(i, j int) bool { return intervals[order[i]].Start < intervals[order[j]].Start })
+		sortedIntervals := make([]Interval, len(intervals))
+		sortedNames := make([]string, len(intervals))
+		for i, j := range order {
+			sortedIntervals[i] = intervals[j]
+			sortedNames[i] = chromNames[j]
+		}
+		regions[chrom] = sortedIntervals
+		names[chrom] = sortedNames
+	}
+	return regions, names, nil
+}
+
+/*
+FindRegion returns the index of the interval in a chromosome's
+Start-sorted Interval slice that contains the 1-based position pos, or
+-1 if pos does not fall inside any of them. The binary search requires
+the intervals to be non-overlapping; pass them through
+ValidateNonOverlapping or CoalesceIntervals first if that is not
+already guaranteed.
+*/
+func FindRegion(intervals []Interval, pos int32) int {
+	i := sort.Search(len(intervals), func(i int) bool { return intervals[i].End >= pos })
+	if i < len(intervals) && pos > intervals[i].Start {
+		return i
+	}
+	return -1
+}
+
+/*
+ValidateNonOverlapping returns an error naming the first pair of
+intervals that overlap on the same chromosome in regions, or nil if all
+chromosomes' intervals are disjoint. SplitFilePerRegion requires this,
+since it assigns each alignment to exactly one shard by interval index;
+callers that only need an "is pos in any region" test can instead use
+CoalesceIntervals, which tolerates overlapping BED entries.
+*/
+func ValidateNonOverlapping(regions map[string][]Interval, names map[string][]string) error {
+	for chrom, intervals := range regions {
+		chromNames := names[chrom]
+		for i := 1; i < len(intervals); i++ {
+			if intervals[i].Start < intervals[i-1].End {
+				return fmt.Errorf(
+					"sam: overlapping intervals on %v: %v and %v; merge them first",
+					chrom, chromNames[i-1], chromNames[i],
+				)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+CoalesceIntervals merges overlapping or adjacent intervals in a
+Start-sorted slice, such as one returned by ParseBEDFile, into the
+minimal equivalent set of disjoint intervals covering the same
+positions. This lets FindRegion be used purely as an "is pos in any
+region" membership test even when the source BED file has overlapping
+entries, at the cost of losing the original per-entry identity.
+*/
+func CoalesceIntervals(intervals []Interval) []Interval {
+	if len(intervals) == 0 {
+		return nil
+	}
+	merged := make([]Interval, 0, len(intervals))
+	current := intervals[0]
+	for _, next := range intervals[1:] {
+		if next.Start <= current.End {
+			if next.End > current.End {
+				current.End = next.End
+			}
+			continue
+		}
+		merged = append(merged, current)
+		current = next
+	}
+	return append(merged, current)
+}
+
+/*
+SplitFilePerRegion splits a SAM/BAM/CRAM input file into one output
+file per interval listed in a BED3/BED4 regions file, grouping each
+alignment by the region its leftmost mapping position (RNAME/POS) falls
+into. Unmapped reads, and reads whose mate lies outside of the region
+its own alignment was assigned to, are written to a separate
+"_spillover" file instead, so that running merge over the region files
+plus the spillover file reproduces the original input bit-for-bit. Each
+output header is rewritten to contain only the SQ entries touched by
+that shard, plus a @CO line recording the region string, so that
+downstream tools can reassemble the shards deterministically.
+*/
+func SplitFilePerRegion(input, output, outputPrefix, outputType, reference_t, reference_T, regionsFile string) (err error) {
+	regions, names, err := ParseBEDFile(regionsFile)
+	if err != nil {
+		return err
+	}
+	if err := ValidateNonOverlapping(regions, names); err != nil {
+		return err
+	}
+
+	in, err := Open(input, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		nerr := in.Close()
+		if err == nil {
+			err = nerr
+		}
+	}()
+
+	header, _, err := ParseHeader(in.Reader)
+	if err != nil {
+		return err
+	}
+
+	sqByName := make(map[string]utils.StringMap, len(header.SQ))
+	for _, sq := range header.SQ {
+		sqByName[sq["SN"]] = sq
+	}
+
+	shards := make(map[string]*OutputFile)
+	var shardKeys []string
+
+	shardFor := func(key, regionString string, sq []utils.StringMap) (*OutputFile, error) {
+		if shard, found := shards[key]; found {
+			return shard, nil
+		}
+		shardHeader := *header
+		shardHeader.SQ = sq
+		shardHeader.CO = append(append([]string{}, header.CO...), "Region: "+regionString)
+		filename := filepath.Join(output, fmt.Sprintf("%v_%v.%v", outputPrefix, key, outputType))
+		out, cerr := Create(filename, outputType, reference_t, reference_T)
+		if cerr != nil {
+			return nil, cerr
+		}
+		if werr := out.WriteHeader(&shardHeader); werr != nil {
+			return nil, werr
+		}
+		shards[key] = out
+		shardKeys = append(shardKeys, key)
+		return out, nil
+	}
+
+	spillover, err := shardFor("spillover", "unmapped reads and reads with a mate outside the selected regions", header.SQ)
+	if err != nil {
+		return err
+	}
+
+	for {
+		aln, aerr := ParseAlignment(in.Reader, header)
+		if aerr == io.EOF {
+			break
+		}
+		if aerr != nil {
+			return aerr
+		}
+
+		idx := -1
+		if (aln.FLAG&Unmapped) == 0 && aln.RNAME != "*" {
+			idx = FindRegion(regions[aln.RNAME], int32(aln.POS))
+		}
+		if idx < 0 {
+			if werr := spillover.WriteAlignment(aln); werr != nil {
+				return werr
+			}
+			continue
+		}
+
+		mateRNAME := aln.RNAME
+		if aln.RNEXT != "=" && aln.RNEXT != "*" {
+			mateRNAME = aln.RNEXT
+		}
+		mateOutside := (aln.FLAG&Paired) != 0 && (aln.FLAG&MateUnmapped) == 0 &&
+			(mateRNAME != aln.RNAME || FindRegion(regions[mateRNAME], int32(aln.PNEXT)) != idx)
+		if mateOutside {
+			if werr := spillover.WriteAlignment(aln); werr != nil {
+				return werr
+			}
+			continue
+		}
+
+		key := fmt.Sprintf("%v_%v", aln.RNAME, idx)
+		shard, serr := shardFor(key, names[aln.RNAME][idx], []utils.StringMap{sqByName[aln.RNAME]})
+		if serr != nil {
+			return serr
+		}
+		if werr := shard.WriteAlignment(aln); werr != nil {
+			return werr
+		}
+	}
+
+	for _, key := range shardKeys {
+		if cerr := shards[key].Close(); cerr != nil {
+			return cerr
+		}
+	}
+	return nil
+}